@@ -0,0 +1,161 @@
+package stomp
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// Chunk size classes used by the pools below. A dataBuffer appends
+// whole chunks from the smallest class that fits, bounding worst-case
+// waste to roughly 2x the largest chunk size.
+const (
+	chunkSize1KiB  = 1 << 10
+	chunkSize4KiB  = 1 << 12
+	chunkSize16KiB = 1 << 14
+	chunkSize64KiB = 1 << 16
+)
+
+var chunkPools = []struct {
+	size int
+	pool *sync.Pool
+}{
+	{chunkSize1KiB, newChunkPool(chunkSize1KiB)},
+	{chunkSize4KiB, newChunkPool(chunkSize4KiB)},
+	{chunkSize16KiB, newChunkPool(chunkSize16KiB)},
+	{chunkSize64KiB, newChunkPool(chunkSize64KiB)},
+}
+
+func newChunkPool(size int) *sync.Pool {
+	return &sync.Pool{
+		New: func() interface{} {
+			buf := make([]byte, size)
+			return &buf
+		},
+	}
+}
+
+// getChunk returns a chunk from the smallest size class able to hold
+// want bytes, falling back to the largest class (callers needing more
+// than chunkSize64KiB take several chunks, same as dataBuffer does).
+func getChunk(want int) []byte {
+	for _, c := range chunkPools {
+		if want <= c.size {
+			return *(c.pool.Get().(*[]byte))
+		}
+	}
+	last := chunkPools[len(chunkPools)-1]
+	return *(last.pool.Get().(*[]byte))
+}
+
+func putChunk(buf []byte) {
+	buf = buf[:cap(buf)]
+	for _, c := range chunkPools {
+		if len(buf) == c.size {
+			c.pool.Put(&buf)
+			return
+		}
+	}
+	// Not a size we recognise (e.g. a one-off allocation); let the GC
+	// reclaim it rather than polluting a pool with the wrong size class.
+}
+
+// dataBuffer is an io.Writer that accumulates a STOMP frame body into
+// pooled, fixed-size chunks up to a caller-supplied limit, rather than
+// one growing per-frame slice. Retain/Release refcount the chunks so a
+// body fanned out to several subscribers is freed once, not copied per
+// subscriber.
+type dataBuffer struct {
+	chunks []byte // backing storage of the most recently appended chunk
+	all    [][]byte
+	size   int64
+	limit  int64
+	refs   int32
+}
+
+// newDataBuffer returns a dataBuffer that rejects writes once limit bytes
+// have been written, mirroring the MaxHeaderBytes enforcement already
+// applied to frame headers. limit is an int64 so callers can pass a
+// Server's Size-typed MaxBodyBytes directly.
+func newDataBuffer(limit int64) *dataBuffer {
+	return &dataBuffer{limit: limit, refs: 1}
+}
+
+// Write implements io.Writer, appending p across as many pooled chunks as
+// required. It returns an error, rather than truncating, if p would grow
+// the buffer past its limit.
+func (b *dataBuffer) Write(p []byte) (int, error) {
+	if b.size+int64(len(p)) > b.limit {
+		return 0, io.ErrShortBuffer
+	}
+	written := 0
+	for len(p) > 0 {
+		if cap(b.chunks)-len(b.chunks) == 0 {
+			b.chunks = getChunk(len(p))[:0]
+			b.all = append(b.all, b.chunks)
+		}
+		room := cap(b.chunks) - len(b.chunks)
+		n := room
+		if n > len(p) {
+			n = len(p)
+		}
+		b.chunks = append(b.chunks, p[:n]...)
+		b.all[len(b.all)-1] = b.chunks
+		p = p[n:]
+		written += n
+		b.size += int64(n)
+	}
+	return written, nil
+}
+
+// Bytes returns the buffered data as a single contiguous slice. If more
+// than one chunk has been written, this allocates and copies; prefer
+// WriteTo when the destination is an io.Writer to avoid that copy.
+func (b *dataBuffer) Bytes() []byte {
+	if len(b.all) <= 1 {
+		if len(b.all) == 0 {
+			return nil
+		}
+		return b.all[0]
+	}
+	out := make([]byte, 0, int(b.size))
+	for _, chunk := range b.all {
+		out = append(out, chunk...)
+	}
+	return out
+}
+
+// WriteTo implements io.WriterTo, writing each chunk directly to w
+// without first concatenating them into a single slice.
+func (b *dataBuffer) WriteTo(w io.Writer) (int64, error) {
+	var total int64
+	for _, chunk := range b.all {
+		n, err := w.Write(chunk)
+		total += int64(n)
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// Retain increments the reference count so that a message fanned out to
+// multiple subscribers is only returned to the chunk pools once every
+// subscriber has called Release.
+func (b *dataBuffer) Retain() {
+	atomic.AddInt32(&b.refs, 1)
+}
+
+// Release decrements the reference count and, once it reaches zero,
+// returns every chunk to its pool. Callers must not use b after the
+// final Release.
+func (b *dataBuffer) Release() {
+	if atomic.AddInt32(&b.refs, -1) > 0 {
+		return
+	}
+	for _, chunk := range b.all {
+		putChunk(chunk)
+	}
+	b.all = nil
+	b.chunks = nil
+}
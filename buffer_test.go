@@ -0,0 +1,92 @@
+package stomp
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestDataBufferWriteAcrossChunks(t *testing.T) {
+	body := newDataBuffer(chunkSize64KiB*2 + 1)
+	data := bytes.Repeat([]byte("x"), chunkSize64KiB*2+1)
+
+	if _, err := body.Write(data); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := body.Bytes(); !bytes.Equal(got, data) {
+		t.Fatalf("got %d bytes, want %d", len(got), len(data))
+	}
+
+	var buf bytes.Buffer
+	if _, err := body.WriteTo(&buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), data) {
+		t.Fatal("WriteTo did not reproduce the written data")
+	}
+
+	body.Release()
+}
+
+func TestDataBufferRejectsOverLimit(t *testing.T) {
+	body := newDataBuffer(4)
+	if _, err := body.Write([]byte("hello")); err == nil {
+		t.Fatal("expected an error writing past the limit")
+	}
+	body.Release()
+}
+
+// fanoutSubscribers is the number of subscribers a benchmark SEND is
+// delivered to, chosen to make the per-subscriber allocation difference
+// between the naive and pooled approaches clearly visible.
+const fanoutSubscribers = 50
+
+// bodySize10KiB is the SEND body size used by the fan-out benchmarks
+// below, matching the size called out in the originating request.
+const bodySize10KiB = 10 * 1024
+
+// BenchmarkSendFanoutNaive simulates delivering a 10KiB SEND body to
+// fanoutSubscribers subscribers the way a per-frame make([]byte, n)
+// allocation path would: one fresh copy per subscriber.
+func BenchmarkSendFanoutNaive(b *testing.B) {
+	src := make([]byte, bodySize10KiB)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		for s := 0; s < fanoutSubscribers; s++ {
+			cp := make([]byte, len(src))
+			copy(cp, src)
+			_ = cp
+		}
+	}
+}
+
+// BenchmarkSendFanoutPooled simulates the same fan-out using dataBuffer,
+// written in bodyReadChunk-sized batches the way readFrameBody actually
+// fills one (so a 10KiB body acquires roughly ten 1KiB chunks, not a
+// single chunk from a larger size class as one full-body Write would),
+// then one Retain per subscriber and a final Release, with no
+// per-subscriber copy of the body.
+func BenchmarkSendFanoutPooled(b *testing.B) {
+	src := make([]byte, bodySize10KiB)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		body := newDataBuffer(bodySize10KiB)
+		for off := 0; off < len(src); off += bodyReadChunk {
+			end := off + bodyReadChunk
+			if end > len(src) {
+				end = len(src)
+			}
+			body.Write(src[off:end])
+		}
+		for s := 0; s < fanoutSubscribers; s++ {
+			body.Retain()
+			body.WriteTo(io.Discard)
+			body.Release()
+		}
+		body.Release()
+	}
+}
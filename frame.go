@@ -0,0 +1,147 @@
+package stomp
+
+import (
+	"bufio"
+	"errors"
+	"strings"
+)
+
+// frame represents a single parsed STOMP frame: a command, an ordered
+// list of headers, and a body. body is backed by pooled chunks (see
+// buffer.go) rather than a dedicated allocation per frame; callers must
+// call body.Release once the frame has been delivered to every
+// subscriber so its chunks return to the pool.
+type frame struct {
+	command string
+	headers []frameHeader
+	body    *dataBuffer
+}
+
+type frameHeader struct {
+	key, value string
+}
+
+// header returns the value of the first header named name, or "" if the
+// frame carries no such header.
+func (f *frame) header(name string) string {
+	for _, h := range f.headers {
+		if h.key == name {
+			return h.value
+		}
+	}
+	return ""
+}
+
+var (
+	errTooManyHeaders = errors.New("too many headers in frame")
+	errHeaderTooLarge = errors.New("header block exceeds MaxHeaderBytes")
+	errBodyTooLarge   = errors.New("body exceeds MaxBodyBytes")
+)
+
+// isFrameLimitErr reports whether err is one of the resource-limit
+// violations above, as opposed to an ordinary I/O error such as the peer
+// closing the connection or a read deadline expiring.
+func isFrameLimitErr(err error) bool {
+	switch err {
+	case errTooManyHeaders, errHeaderTooLarge, errBodyTooLarge:
+		return true
+	default:
+		return false
+	}
+}
+
+// readFrameHead reads the command line and header block of a single
+// STOMP frame from br, skipping the blank lines STOMP clients send as
+// heart-beats between frames. It enforces maxHeaders header lines and
+// maxHeaderBytes total bytes across the command line and headers. The
+// body is read separately by readFrameBody, so that the caller can
+// switch read deadlines between the two phases.
+func readFrameHead(br *bufio.Reader, maxHeaders int, maxHeaderBytes int64) (*frame, error) {
+	var used int64
+
+	var command string
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		used += int64(len(line))
+		if used > maxHeaderBytes {
+			return nil, errHeaderTooLarge
+		}
+		if trimmed := strings.TrimRight(line, "\r\n"); trimmed != "" {
+			command = trimmed
+			break
+		}
+	}
+
+	f := &frame{command: command}
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		used += int64(len(line))
+		if used > maxHeaderBytes {
+			return nil, errHeaderTooLarge
+		}
+		trimmed := strings.TrimRight(line, "\r\n")
+		if trimmed == "" {
+			break
+		}
+		if len(f.headers) >= maxHeaders {
+			return nil, errTooManyHeaders
+		}
+		key, value := trimmed, ""
+		if i := strings.IndexByte(trimmed, ':'); i >= 0 {
+			key, value = trimmed[:i], trimmed[i+1:]
+		}
+		f.headers = append(f.headers, frameHeader{key, value})
+	}
+	return f, nil
+}
+
+// readFrameBody reads the NUL-terminated body following a frame's
+// headers into a dataBuffer backed by pooled chunks (see buffer.go),
+// rejecting bodies larger than maxBodyBytes rather than buffering an
+// unbounded, attacker-controlled amount of data. Bytes are accumulated
+// in bodyReadChunk-sized batches rather than one dataBuffer.Write call
+// per byte, so the pooled chunks are actually exercised in bulk.
+func readFrameBody(br *bufio.Reader, maxBodyBytes int64) (*dataBuffer, error) {
+	body := newDataBuffer(maxBodyBytes)
+
+	var pending [bodyReadChunk]byte
+	n := 0
+	flush := func() error {
+		if n == 0 {
+			return nil
+		}
+		_, err := body.Write(pending[:n])
+		n = 0
+		return err
+	}
+
+	for {
+		b, err := br.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if b == 0 {
+			if err := flush(); err != nil {
+				return nil, errBodyTooLarge
+			}
+			return body, nil
+		}
+		pending[n] = b
+		n++
+		if n == len(pending) {
+			if err := flush(); err != nil {
+				return nil, errBodyTooLarge
+			}
+		}
+	}
+}
+
+// bodyReadChunk is the batch size readFrameBody accumulates bytes into
+// before writing them to the frame's dataBuffer.
+const bodyReadChunk = 256
@@ -0,0 +1,274 @@
+package stomp
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// requestProcessor accepts connections on behalf of a Server, reads
+// STOMP frames from each, and enforces the resource limits configured on
+// Server before any higher-level routing takes place.
+type requestProcessor struct {
+	server *Server
+
+	mu       sync.Mutex
+	sessions map[*session]struct{}
+	conns    int
+
+	wg sync.WaitGroup
+}
+
+func newRequestProcessor(s *Server) *requestProcessor {
+	return &requestProcessor{server: s, sessions: make(map[*session]struct{})}
+}
+
+// Serve accepts connections from l until it returns an error, serving
+// each on its own goroutine.
+func (p *requestProcessor) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		if !p.tryAcceptConn(conn) {
+			continue
+		}
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			p.serveConn(conn)
+		}()
+	}
+}
+
+// tryAcceptConn enforces Server.MaxConnections, closing conn immediately
+// if the cap has already been reached, as documented on that field.
+func (p *requestProcessor) tryAcceptConn(conn net.Conn) bool {
+	max := p.server.MaxConnections
+	if max == 0 {
+		max = DefaultMaxConnections
+	}
+
+	p.mu.Lock()
+	if max > 0 && p.conns >= max {
+		p.mu.Unlock()
+		conn.Close()
+		return false
+	}
+	p.conns++
+	p.mu.Unlock()
+	return true
+}
+
+func (p *requestProcessor) connDone() {
+	p.mu.Lock()
+	p.conns--
+	p.mu.Unlock()
+}
+
+func (p *requestProcessor) addSession(sess *session) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.sessions[sess] = struct{}{}
+}
+
+func (p *requestProcessor) removeSession(sess *session) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.sessions, sess)
+}
+
+// serveConn reads and enforces limits on frames from conn until a
+// resource limit is violated, the connection is closed by the peer, or
+// Shutdown asks the session to stop.
+func (p *requestProcessor) serveConn(conn net.Conn) {
+	defer p.connDone()
+	defer conn.Close()
+
+	sess := newSession(conn)
+	p.addSession(sess)
+	defer p.removeSession(sess)
+
+	s := p.server
+	maxHeaders := s.MaxHeadersPerFrame
+	if maxHeaders == 0 {
+		maxHeaders = DefaultMaxHeadersPerFrame
+	}
+	maxHeaderBytes := s.resolvedMaxHeaderBytes()
+	maxBodyBytes := s.resolvedMaxBodyBytes()
+	maxSubs := s.MaxSubscriptionsPerConn
+	if maxSubs == 0 {
+		maxSubs = DefaultMaxSubscriptionsPerConn
+	}
+	maxTx := s.MaxTransactionsPerConn
+	if maxTx == 0 {
+		maxTx = DefaultMaxTransactionsPerConn
+	}
+	readHeaderTimeout := s.resolvedReadHeaderTimeout()
+	heartBeat := s.HeartBeat
+	if heartBeat == 0 {
+		heartBeat = DefaultHeartBeat
+	}
+
+	br := bufio.NewReader(conn)
+
+	for {
+		// Idle time waiting for the next frame to start is still governed
+		// by the heart-beat deadline; only once its first byte has
+		// actually arrived do we narrow to ReadHeaderTimeout below, so a
+		// client idling well within its negotiated heart-beat interval
+		// isn't disconnected early. Heart-beat EOLs sent between frames
+		// are consumed here, each renewing the heart-beat deadline, so
+		// they are not taken for the first byte of a frame.
+		for {
+			conn.SetReadDeadline(time.Now().Add(heartBeat))
+			b, err := br.Peek(1)
+			if err != nil {
+				p.reportReadError(sess, err)
+				return
+			}
+			if b[0] != '\n' && b[0] != '\r' {
+				break
+			}
+			br.ReadByte()
+		}
+
+		// The header phase gets its own, shorter deadline so a peer that
+		// trickles a CONNECT or subsequent frame's headers one byte at a
+		// time can't hold the connection open for a full heart-beat
+		// interval (see Server.ReadHeaderTimeout).
+		conn.SetReadDeadline(time.Now().Add(readHeaderTimeout))
+		f, err := readFrameHead(br, maxHeaders, maxHeaderBytes)
+		if err != nil {
+			p.reportReadError(sess, err)
+			return
+		}
+
+		// Once headers are in hand, fall back to the heart-beat-derived
+		// deadline for the body and for idle time before the next frame.
+		conn.SetReadDeadline(time.Now().Add(heartBeat))
+		body, err := readFrameBody(br, maxBodyBytes)
+		if err != nil {
+			p.reportReadError(sess, err)
+			return
+		}
+		f.body = body
+
+		limitErr := applyConnLimits(sess, f, maxSubs, maxTx)
+		// Nothing downstream of applyConnLimits retains a reference to
+		// the body yet (there is no subscriber fan-out in this tree), so
+		// its chunks can go back to the pool as soon as this frame has
+		// been processed.
+		f.body.Release()
+		if limitErr != nil {
+			p.writeFrame(sess, errorFrameText(limitErr.Error()))
+			return
+		}
+	}
+}
+
+// reportReadError sends an ERROR frame when err is a resource-limit
+// violation, or when the connection is being closed by a graceful
+// Shutdown; any other read error (EOF, reset, timed-out idle connection)
+// is assumed to mean the peer is already gone and nothing is sent.
+func (p *requestProcessor) reportReadError(sess *session, err error) {
+	if isFrameLimitErr(err) {
+		p.writeFrame(sess, errorFrameText(err.Error()))
+		return
+	}
+	select {
+	case <-sess.closing:
+		p.writeFrame(sess, errorFrameText("server shutting down"))
+	default:
+	}
+}
+
+// applyConnLimits enforces MaxSubscriptionsPerConn and
+// MaxTransactionsPerConn against f, updating sess's bookkeeping for
+// SUBSCRIBE/UNSUBSCRIBE and BEGIN/COMMIT/ABORT frames.
+func applyConnLimits(sess *session, f *frame, maxSubs, maxTx int) error {
+	switch f.command {
+	case "SUBSCRIBE":
+		if sess.subscriptionCount() >= maxSubs {
+			return errTooManySubscriptions
+		}
+		sess.addSubscription(f.header("id"))
+	case "UNSUBSCRIBE":
+		sess.removeSubscription(f.header("id"))
+	case "BEGIN":
+		if sess.transactionCount() >= maxTx {
+			return errTooManyTransactions
+		}
+		sess.addTransaction(f.header("transaction"))
+	case "COMMIT", "ABORT":
+		sess.removeTransaction(f.header("transaction"))
+	}
+	return nil
+}
+
+// writeFrame writes a frame to sess's connection, applying
+// Server.WriteTimeout as the write deadline when one is configured.
+func (p *requestProcessor) writeFrame(sess *session, data string) {
+	if wt := p.server.WriteTimeout; wt > 0 {
+		sess.conn.SetWriteDeadline(time.Now().Add(wt))
+	}
+	io.WriteString(sess.conn, data)
+}
+
+func errorFrameText(msg string) string {
+	return "ERROR\ncontent-type:text/plain\n\n" + msg + "\x00"
+}
+
+// drain asks every active session to stop: it closes each session's
+// closing channel (which also expires its read deadline so a blocked
+// serveConn notices promptly) and waits for every serveConn goroutine
+// started by this processor to exit, or for ctx to be done, whichever
+// happens first.
+func (p *requestProcessor) drain(ctx context.Context) {
+	p.mu.Lock()
+	sessions := make([]*session, 0, len(p.sessions))
+	for sess := range p.sessions {
+		sessions = append(sessions, sess)
+	}
+	p.mu.Unlock()
+
+	for _, sess := range sessions {
+		sess.requestClose()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+}
+
+// closeAll forcibly closes every connection this processor is currently
+// serving.
+func (p *requestProcessor) closeAll() {
+	p.mu.Lock()
+	sessions := make([]*session, 0, len(p.sessions))
+	for sess := range p.sessions {
+		sessions = append(sessions, sess)
+	}
+	p.mu.Unlock()
+
+	for _, sess := range sessions {
+		sess.conn.Close()
+	}
+}
+
+var (
+	errTooManySubscriptions = errors.New("exceeded MaxSubscriptionsPerConn")
+	errTooManyTransactions  = errors.New("exceeded MaxTransactionsPerConn")
+)
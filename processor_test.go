@@ -0,0 +1,166 @@
+package stomp
+
+import (
+	"bufio"
+	"net"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestMaxSubscriptionsPerConnClosesWithoutLeakingGoroutines verifies that
+// a connection which exceeds MaxSubscriptionsPerConn is sent an ERROR
+// frame and disconnected, and that doing so does not leak the goroutine
+// serveConn runs on.
+func TestMaxSubscriptionsPerConnClosesWithoutLeakingGoroutines(t *testing.T) {
+	s := &Server{MaxSubscriptionsPerConn: 2}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go s.Serve(l)
+	defer s.Close()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	runtime.Gosched()
+	before := runtime.NumGoroutine()
+
+	for i := 0; i < 3; i++ {
+		f := "SUBSCRIBE\nid:sub-" + strconv.Itoa(i) + "\ndestination:/queue/a\n\n\x00"
+		if _, err := conn.Write([]byte(f)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	br := bufio.NewReader(conn)
+	line, err := br.ReadString('\n')
+	if err != nil {
+		t.Fatalf("expected ERROR frame, got read error: %v", err)
+	}
+	if strings.TrimSpace(line) != "ERROR" {
+		t.Fatalf("expected ERROR frame, got %q", line)
+	}
+
+	// The server should close its side of the connection once the
+	// MaxSubscriptionsPerConn violation is reported.
+	buf := make([]byte, 16)
+	for {
+		if _, err := conn.Read(buf); err != nil {
+			break
+		}
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if runtime.NumGoroutine() <= before {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("goroutine count did not return to baseline: before=%d after=%d", before, runtime.NumGoroutine())
+}
+
+// TestMaxTransactionsPerConnClosesWithoutLeakingGoroutines verifies that
+// a connection which exceeds MaxTransactionsPerConn is sent an ERROR
+// frame and disconnected, and that doing so does not leak the goroutine
+// serveConn runs on.
+func TestMaxTransactionsPerConnClosesWithoutLeakingGoroutines(t *testing.T) {
+	s := &Server{MaxTransactionsPerConn: 2}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go s.Serve(l)
+	defer s.Close()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	runtime.Gosched()
+	before := runtime.NumGoroutine()
+
+	for i := 0; i < 3; i++ {
+		f := "BEGIN\ntransaction:tx-" + strconv.Itoa(i) + "\n\n\x00"
+		if _, err := conn.Write([]byte(f)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	br := bufio.NewReader(conn)
+	line, err := br.ReadString('\n')
+	if err != nil {
+		t.Fatalf("expected ERROR frame, got read error: %v", err)
+	}
+	if strings.TrimSpace(line) != "ERROR" {
+		t.Fatalf("expected ERROR frame, got %q", line)
+	}
+
+	// The server should close its side of the connection once the
+	// MaxTransactionsPerConn violation is reported.
+	buf := make([]byte, 16)
+	for {
+		if _, err := conn.Read(buf); err != nil {
+			break
+		}
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if runtime.NumGoroutine() <= before {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("goroutine count did not return to baseline: before=%d after=%d", before, runtime.NumGoroutine())
+}
+
+// TestMaxConnectionsClosesExcessConnections verifies that a connection
+// accepted beyond MaxConnections is closed immediately, as documented on
+// Server.MaxConnections. It does not count goroutines: a rejected
+// connection is closed in the accept loop without a serveConn goroutine
+// being started for it.
+func TestMaxConnectionsClosesExcessConnections(t *testing.T) {
+	s := &Server{MaxConnections: 1}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go s.Serve(l)
+	defer s.Close()
+
+	first, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+
+	second, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+
+	second.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, 16)
+	if _, err := second.Read(buf); err == nil {
+		t.Fatal("expected the connection beyond MaxConnections to be closed")
+	}
+}
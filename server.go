@@ -1,7 +1,9 @@
 package stomp
 
 import (
+	"crypto/tls"
 	"net"
+	"sync"
 	"time"
 )
 
@@ -31,6 +33,33 @@ const (
 	// Default read timeout for heart-beat.
 	// Override by setting Server.HeartBeat.
 	DefaultHeartBeat = time.Minute
+
+	// Default amount of time Shutdown waits for in-flight messages to
+	// drain before forcibly closing remaining connections.
+	// Override by setting Server.ShutdownTimeout.
+	DefaultShutdownTimeout = 10 * time.Second
+
+	// Default maximum number of subscriptions a single connection may
+	// have open at once. Override by setting Server.MaxSubscriptionsPerConn.
+	DefaultMaxSubscriptionsPerConn = 1024
+
+	// Default maximum number of transactions a single connection may
+	// have open at once. Override by setting Server.MaxTransactionsPerConn.
+	DefaultMaxTransactionsPerConn = 64
+
+	// Default maximum number of headers a single STOMP frame may carry.
+	// Override by setting Server.MaxHeadersPerFrame.
+	DefaultMaxHeadersPerFrame = 1000
+
+	// Default maximum number of simultaneous connections the server will
+	// accept. Override by setting Server.MaxConnections. Zero means no
+	// limit.
+	DefaultMaxConnections = 0
+
+	// Default deadline for reading the CONNECT/STOMP frame and the
+	// header block of every subsequent frame, independent of HeartBeat.
+	// Override by setting Server.ReadHeaderTimeout.
+	DefaultReadHeaderTimeout = 30 * time.Second
 )
 
 // Interface for authenticating STOMP clients.
@@ -44,10 +73,93 @@ type Authenticator interface {
 type Server struct {
 	Addr           string        // TCP address to listen on, DefaultAddr if empty
 	Authenticator  Authenticator // Authenticates login/passcodes. If nil no authentication is performed
-	QueueStorage   QueueStorage  // Implementation of queue storage. If nil, in-memory queues are used.
 	HeartBeat      time.Duration // Preferred value for heart-beat read/write timeout, if zero, then DefaultHeartBeat.
-	MaxHeaderBytes int           // Maximum size of STOMP headers in bytes, if zero then DefaultMaxHeaderBytes.
-	MaxBodyBytes   int           // Maximum size of STOMP body in bytes, if zero then DefaultMaxBodyBytes.
+
+	// ReadHeaderTimeout bounds how long reading the CONNECT/STOMP frame,
+	// and the header block of every subsequent frame, may take, applied
+	// instead of the heart-beat deadline for that narrower window. Once
+	// headers are read, the connection reverts to the heart-beat-derived
+	// deadline. If zero, DefaultReadHeaderTimeout is used.
+	ReadHeaderTimeout time.Duration
+
+	// WriteTimeout bounds how long flushing an outbound frame may take,
+	// independent of HeartBeat. If zero, no write deadline is applied.
+	WriteTimeout time.Duration
+	// Maximum size of STOMP headers in bytes, if zero then
+	// DefaultMaxHeaderBytes. Size also accepts unit-suffixed strings
+	// (e.g. "4KiB") from TOML, JSON or an environment variable.
+	MaxHeaderBytes Size
+
+	// Maximum size of STOMP body in bytes, if zero then
+	// DefaultMaxBodyBytes. See MaxHeaderBytes for configuration format.
+	MaxBodyBytes Size
+
+	// MaxSubscriptionsPerConn caps the number of subscriptions a single
+	// connection may have open at once, if zero then
+	// DefaultMaxSubscriptionsPerConn. A SUBSCRIBE that would exceed the
+	// cap is rejected with an ERROR frame and the connection is closed.
+	MaxSubscriptionsPerConn int
+
+	// MaxTransactionsPerConn caps the number of transactions a single
+	// connection may have open at once, if zero then
+	// DefaultMaxTransactionsPerConn. A BEGIN that would exceed the cap is
+	// rejected with an ERROR frame and the connection is closed.
+	MaxTransactionsPerConn int
+
+	// MaxHeadersPerFrame caps the number of headers a single STOMP frame
+	// may carry, if zero then DefaultMaxHeadersPerFrame. A frame with
+	// more headers is rejected with an ERROR frame and the connection is
+	// closed.
+	MaxHeadersPerFrame int
+
+	// MaxConnections caps the number of simultaneous connections the
+	// server will accept, if zero then DefaultMaxConnections (no limit).
+	// Connections beyond the cap are closed immediately after accept.
+	MaxConnections int
+
+	// TLSConfig configures ListenAndServeTLS's listener. Set this
+	// directly for client certificate auth, custom cipher suites or ALPN;
+	// otherwise certFile/keyFile supply the certificate. TLSConfig itself
+	// is not modified by ListenAndServeTLS.
+	TLSConfig *tls.Config
+
+	// ShutdownTimeout bounds how long Shutdown waits for sessions to
+	// drain before forcibly closing remaining connections, when ctx has
+	// no earlier deadline. If zero, DefaultShutdownTimeout is used.
+	ShutdownTimeout time.Duration
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	procs     map[*requestProcessor]struct{}
+	onShutdown []func()
+	closed    bool
+}
+
+// resolvedMaxHeaderBytes returns s.MaxHeaderBytes, or
+// DefaultMaxHeaderBytes if unset.
+func (s *Server) resolvedMaxHeaderBytes() int64 {
+	if s.MaxHeaderBytes != 0 {
+		return int64(s.MaxHeaderBytes)
+	}
+	return DefaultMaxHeaderBytes
+}
+
+// resolvedMaxBodyBytes returns s.MaxBodyBytes, or DefaultMaxBodyBytes if
+// unset.
+func (s *Server) resolvedMaxBodyBytes() int64 {
+	if s.MaxBodyBytes != 0 {
+		return int64(s.MaxBodyBytes)
+	}
+	return DefaultMaxBodyBytes
+}
+
+// resolvedReadHeaderTimeout returns s.ReadHeaderTimeout, or
+// DefaultReadHeaderTimeout if unset.
+func (s *Server) resolvedReadHeaderTimeout() time.Duration {
+	if s.ReadHeaderTimeout != 0 {
+		return s.ReadHeaderTimeout
+	}
+	return DefaultReadHeaderTimeout
 }
 
 func ListenAndServe(addr string) error {
@@ -81,5 +193,49 @@ func (s *Server) ListenAndServe() error {
 // requests and then process each request.
 func (s *Server) Serve(l net.Listener) error {
 	proc := newRequestProcessor(s)
-	return proc.Serve(l)
+	if err := s.trackListener(l, proc); err != nil {
+		return err
+	}
+	defer s.untrackListener(l, proc)
+
+	err := proc.Serve(l)
+	if s.isClosed() {
+		return ErrServerClosed
+	}
+	return err
+}
+
+// Listens for TLS connections on the TCP network address s.Addr and
+// then calls Serve to handle requests on the incoming connections. If
+// s.Addr is blank, then DefaultAddr is used.
+//
+// Mirrors net/http.Server.ListenAndServeTLS: certFile and keyFile load a
+// certificate pair into a copy of s.TLSConfig unless it already sets
+// Certificates or GetCertificate; s.TLSConfig itself is left unchanged.
+func (s *Server) ListenAndServeTLS(certFile, keyFile string) error {
+	addr := s.Addr
+	if addr == "" {
+		addr = DefaultAddr
+	}
+
+	config := s.TLSConfig
+	if config == nil {
+		config = &tls.Config{}
+	} else {
+		config = config.Clone()
+	}
+	if len(config.Certificates) == 0 && config.GetCertificate == nil {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	return s.Serve(tls.NewListener(l, config))
 }
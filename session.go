@@ -0,0 +1,78 @@
+package stomp
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// session holds the per-connection state the request processor needs to
+// enforce Server's resource limits: which subscriptions and transactions
+// a connection currently has open, and the channel used to ask its
+// serving goroutine to stop during a graceful Shutdown.
+type session struct {
+	conn net.Conn
+
+	mu            sync.Mutex
+	subscriptions map[string]struct{}
+	transactions  map[string]struct{}
+
+	closing   chan struct{}
+	closeOnce sync.Once
+}
+
+func newSession(conn net.Conn) *session {
+	return &session{
+		conn:          conn,
+		subscriptions: make(map[string]struct{}),
+		transactions:  make(map[string]struct{}),
+		closing:       make(chan struct{}),
+	}
+}
+
+// requestClose asks the session's serving goroutine to stop: it closes
+// the closing channel and nudges any blocked Read with an expired
+// deadline so the goroutine notices promptly instead of waiting out a
+// full heart-beat interval.
+func (sess *session) requestClose() {
+	sess.closeOnce.Do(func() {
+		close(sess.closing)
+		sess.conn.SetReadDeadline(time.Now())
+	})
+}
+
+func (sess *session) addSubscription(id string) {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	sess.subscriptions[id] = struct{}{}
+}
+
+func (sess *session) removeSubscription(id string) {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	delete(sess.subscriptions, id)
+}
+
+func (sess *session) subscriptionCount() int {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	return len(sess.subscriptions)
+}
+
+func (sess *session) addTransaction(id string) {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	sess.transactions[id] = struct{}{}
+}
+
+func (sess *session) removeTransaction(id string) {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	delete(sess.transactions, id)
+}
+
+func (sess *session) transactionCount() int {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	return len(sess.transactions)
+}
@@ -0,0 +1,162 @@
+package stomp
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+)
+
+// ErrServerClosed is returned by Server's Serve, ListenAndServe and
+// ListenAndServeTLS methods after a call to Shutdown or Close, in the
+// same manner as http.ErrServerClosed.
+var ErrServerClosed = errors.New("stomp: Server closed")
+
+// trackListener registers l and proc as active, or returns
+// ErrServerClosed if the server has already been shut down.
+func (s *Server) trackListener(l net.Listener, proc *requestProcessor) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrServerClosed
+	}
+	if s.listeners == nil {
+		s.listeners = make(map[net.Listener]struct{})
+	}
+	if s.procs == nil {
+		s.procs = make(map[*requestProcessor]struct{})
+	}
+	s.listeners[l] = struct{}{}
+	s.procs[proc] = struct{}{}
+	return nil
+}
+
+func (s *Server) untrackListener(l net.Listener, proc *requestProcessor) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.listeners, l)
+	delete(s.procs, proc)
+}
+
+func (s *Server) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+// RegisterOnShutdown registers a function to call when Shutdown is
+// called, in the same manner as http.Server.RegisterOnShutdown. This is
+// intended for callers that need to flush their own state and cannot do
+// so from within Shutdown itself. f is called in its own goroutine and
+// should return promptly, since Shutdown's drain deadline does not wait
+// for it.
+func (s *Server) RegisterOnShutdown(f func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onShutdown = append(s.onShutdown, f)
+}
+
+// Shutdown gracefully shuts down the server: it closes all open
+// listeners, notifies live sessions with a courteous ERROR frame, and
+// waits for their processors to drain before forcing remaining
+// connections closed.
+//
+// It waits for the drain or for ctx to be done, whichever comes first;
+// if ctx has no deadline, s.ShutdownTimeout (or DefaultShutdownTimeout)
+// is applied instead. Shutdown returns ctx's error if the deadline was
+// exceeded, otherwise nil. RegisterOnShutdown hooks run concurrently
+// with the drain, not after it.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+
+	for l := range s.listeners {
+		l.Close()
+	}
+	procs := make([]*requestProcessor, 0, len(s.procs))
+	for proc := range s.procs {
+		procs = append(procs, proc)
+	}
+	hooks := s.onShutdown
+	s.mu.Unlock()
+
+	for _, f := range hooks {
+		go f()
+	}
+
+	if _, hasDeadline := ctx.Deadline(); !hasDeadline {
+		timeout := s.ShutdownTimeout
+		if timeout == 0 {
+			timeout = DefaultShutdownTimeout
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	// Drain every processor concurrently: a Server with more than one
+	// active listener (for example a plain TCP Serve alongside a
+	// ServeWebSocket) would otherwise have ShutdownTimeout divided up
+	// unfairly across listeners, force-closing a later processor's
+	// sessions that would have finished draining in time.
+	drained := make(chan struct{})
+	go func() {
+		var wg sync.WaitGroup
+		for _, proc := range procs {
+			wg.Add(1)
+			go func(proc *requestProcessor) {
+				defer wg.Done()
+				proc.drain(ctx)
+			}(proc)
+		}
+		wg.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		for _, proc := range procs {
+			proc.closeAll()
+		}
+		return ctx.Err()
+	}
+}
+
+// Close immediately closes all active listeners and connections without
+// waiting for in-flight messages to drain. For a graceful shutdown, use
+// Shutdown instead.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+
+	var err error
+	for l := range s.listeners {
+		if cerr := l.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	procs := make([]*requestProcessor, 0, len(s.procs))
+	for proc := range s.procs {
+		procs = append(procs, proc)
+	}
+	hooks := s.onShutdown
+	s.mu.Unlock()
+
+	for _, f := range hooks {
+		go f()
+	}
+	for _, proc := range procs {
+		proc.closeAll()
+	}
+	return err
+}
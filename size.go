@@ -0,0 +1,128 @@
+package stomp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Size is a byte count that unmarshals from plain integers or
+// unit-suffixed strings (e.g. "4KiB", "1MiB", "512kB"), so config files
+// and environment variables need not hand-compute values like 1<<20.
+type Size int64
+
+// sizeUnits maps a recognised suffix to its byte multiplier. Both IEC
+// (base-1024, "KiB"/"MiB"/"GiB"/"TiB") and SI (base-1000, "kB"/"MB"/
+// "GB"/"TB") suffixes are accepted; "KB" is treated as an alias for
+// "KiB" since that usage is common in the wild despite being technically
+// ambiguous.
+var sizeUnits = map[string]int64{
+	"B": 1,
+
+	"kB":  1000,
+	"MB":  1000 * 1000,
+	"GB":  1000 * 1000 * 1000,
+	"TB":  1000 * 1000 * 1000 * 1000,
+
+	"KB":  1 << 10,
+	"KiB": 1 << 10,
+	"MiB": 1 << 20,
+	"GiB": 1 << 30,
+	"TiB": 1 << 40,
+}
+
+// ParseSize parses a byte size such as "4KiB", "1MiB" or "512kB", or a
+// plain integer number of bytes, and returns the number of bytes it
+// represents. It returns an error if s is malformed, negative, or would
+// overflow int64.
+func ParseSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, fmt.Errorf("stomp: empty size")
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err == nil {
+		if n < 0 {
+			return 0, fmt.Errorf("stomp: negative size %q", s)
+		}
+		return n, nil
+	}
+	if errors.Is(err, strconv.ErrRange) {
+		return 0, fmt.Errorf("stomp: size %q overflows int64", s)
+	}
+
+	i := 0
+	for i < len(s) && (s[i] == '.' || s[i] == '-' || s[i] == '+' || (s[i] >= '0' && s[i] <= '9')) {
+		i++
+	}
+	if i == 0 {
+		return 0, fmt.Errorf("stomp: invalid size %q", s)
+	}
+	numPart, unitPart := s[:i], strings.TrimSpace(s[i:])
+
+	value, err := strconv.ParseFloat(numPart, 64)
+	if err != nil {
+		return 0, fmt.Errorf("stomp: invalid size %q: %w", s, err)
+	}
+	if value < 0 {
+		return 0, fmt.Errorf("stomp: negative size %q", s)
+	}
+
+	multiplier, ok := sizeUnits[unitPart]
+	if !ok {
+		return 0, fmt.Errorf("stomp: unrecognised size unit %q in %q", unitPart, s)
+	}
+
+	bytesF := value * float64(multiplier)
+	// math.MaxInt64 (2^63-1) isn't exactly representable as a float64; it
+	// rounds up to 2^63 when widened for this comparison, so a strict ">"
+	// here lets a bytesF that lands exactly on 2^63 slip through and then
+	// wrap to a negative number on the int64(bytesF) conversion below.
+	// ">=" rejects that boundary value too.
+	if bytesF >= math.MaxInt64 {
+		return 0, fmt.Errorf("stomp: size %q overflows int64", s)
+	}
+	return int64(bytesF), nil
+}
+
+// String returns s formatted as a plain byte count.
+func (s Size) String() string {
+	return strconv.FormatInt(int64(s), 10)
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, allowing Size to be
+// populated directly from environment variables and any config format
+// that unmarshals scalars via UnmarshalText (e.g. many YAML decoders).
+func (s *Size) UnmarshalText(text []byte) error {
+	n, err := ParseSize(string(text))
+	if err != nil {
+		return err
+	}
+	*s = Size(n)
+	return nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler, accepting either a bare
+// JSON number of bytes or a unit-suffixed string.
+func (s *Size) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if len(data) >= 2 && data[0] == '"' && data[len(data)-1] == '"' {
+		return s.UnmarshalText(data[1 : len(data)-1])
+	}
+	return s.UnmarshalText(data)
+}
+
+// UnmarshalTOML serves TOML decoders that hand a value's raw text to an
+// UnmarshalTOML([]byte) error method, accepting either a bare TOML integer or a unit-suffixed string, in the
+// same manner as UnmarshalJSON.
+func (s *Size) UnmarshalTOML(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if len(data) >= 2 && data[0] == '"' && data[len(data)-1] == '"' {
+		return s.UnmarshalText(data[1 : len(data)-1])
+	}
+	return s.UnmarshalText(data)
+}
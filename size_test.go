@@ -0,0 +1,73 @@
+package stomp
+
+import "testing"
+
+func TestParseSizeRoundTrip(t *testing.T) {
+	cases := []struct {
+		in   string
+		want int64
+	}{
+		{"0", 0},
+		{"1024", 1024},
+		{"4KiB", 4 * 1024},
+		{"1MiB", 1 << 20},
+		{"512kB", 512 * 1000},
+		{"2MB", 2 * 1000 * 1000},
+		{"1GiB", 1 << 30},
+		{"1.5KiB", 1536},
+	}
+	for _, c := range cases {
+		got, err := ParseSize(c.in)
+		if err != nil {
+			t.Errorf("ParseSize(%q): unexpected error: %v", c.in, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("ParseSize(%q) = %d, want %d", c.in, got, c.want)
+		}
+	}
+}
+
+func TestParseSizeRejectsNegative(t *testing.T) {
+	for _, in := range []string{"-1", "-4KiB"} {
+		if _, err := ParseSize(in); err == nil {
+			t.Errorf("ParseSize(%q): expected an error, got none", in)
+		}
+	}
+}
+
+func TestParseSizeRejectsOverflow(t *testing.T) {
+	for _, in := range []string{
+		"9223372036854775808B", // 2^63, one past math.MaxInt64
+		"9223372036854775807KiB",
+		"1000000000000000000000",
+	} {
+		n, err := ParseSize(in)
+		if err == nil {
+			t.Errorf("ParseSize(%q) = %d, want overflow error", in, n)
+		}
+	}
+}
+
+func TestParseSizeRejectsUnknownUnit(t *testing.T) {
+	if _, err := ParseSize("4XiB"); err == nil {
+		t.Error(`ParseSize("4XiB"): expected an error, got none`)
+	}
+}
+
+func TestSizeUnmarshalJSON(t *testing.T) {
+	var s Size
+	if err := s.UnmarshalJSON([]byte(`"4KiB"`)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if s != Size(4*1024) {
+		t.Errorf("got %d, want %d", s, 4*1024)
+	}
+
+	if err := s.UnmarshalJSON([]byte(`2048`)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if s != Size(2048) {
+		t.Errorf("got %d, want %d", s, 2048)
+	}
+}
@@ -0,0 +1,355 @@
+package stomp
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// websocketGUID is the magic value defined by RFC 6455 section 1.3,
+// concatenated with the client's Sec-WebSocket-Key before hashing to
+// produce Sec-WebSocket-Accept.
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// ServeWebSocket listens on l for HTTP connections, upgrades any request
+// for path to the WebSocket protocol, and serves STOMP frames carried as
+// WebSocket text or binary messages over the upgraded connection. This is
+// the transport expected by browser STOMP clients such as stomp.js and
+// RabbitMQ's Web-STOMP plugin, which cannot open a raw TCP socket.
+//
+// ServeWebSocket blocks until l is closed or an unrecoverable error
+// occurs, in the same manner as Serve.
+func (s *Server) ServeWebSocket(l net.Listener, path string) error {
+	wsl := newUpgradeListener(l)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgradeWebSocket(s, w, r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		wsl.submit(conn)
+	})
+
+	readHeaderTimeout := s.resolvedReadHeaderTimeout()
+	httpServer := &http.Server{
+		Handler: mux,
+		// Without these the HTTP upgrade itself is open to the same
+		// slow-loris class ReadHeaderTimeout defends raw STOMP
+		// connections against in processor.go.
+		ReadHeaderTimeout: readHeaderTimeout,
+		ReadTimeout:       readHeaderTimeout,
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- httpServer.Serve(wsl.httpListener())
+		// l was closed (or failed): stop Accept so s.Serve returns too.
+		wsl.Close()
+	}()
+
+	err := s.Serve(wsl)
+	httpServer.Close()
+	if err == nil {
+		err = <-errCh
+	}
+	return err
+}
+
+// upgradeWebSocket performs the RFC 6455 handshake on w/r and returns the
+// hijacked connection wrapped so that Read and Write transparently frame
+// and unframe WebSocket messages, letting the rest of the server treat it
+// like any other net.Conn carrying a stream of STOMP frames.
+func upgradeWebSocket(s *Server, w http.ResponseWriter, r *http.Request) (net.Conn, error) {
+	if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		return nil, errors.New("stomp: not a websocket upgrade request")
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		return nil, errors.New("stomp: missing Sec-WebSocket-Key")
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, errors.New("stomp: response writer does not support hijacking")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	accept := websocketAccept(key)
+	resp := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + accept + "\r\n"
+	if proto := r.Header.Get("Sec-WebSocket-Protocol"); proto != "" {
+		resp += "Sec-WebSocket-Protocol: " + firstProtocol(proto) + "\r\n"
+	}
+	resp += "\r\n"
+
+	if _, err := rw.Writer.WriteString(resp); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := rw.Writer.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	// A STOMP frame arrives over WebSocket as a single message, so the
+	// message may carry both the header block and the body; bound it by
+	// their sum rather than risk truncating a legitimately large frame
+	// that fits Server's own limits.
+	maxPayload := s.resolvedMaxHeaderBytes() + s.resolvedMaxBodyBytes()
+
+	return &websocketConn{Conn: conn, br: rw.Reader, maxPayload: maxPayload}, nil
+}
+
+// websocketAccept computes the Sec-WebSocket-Accept header value for the
+// given Sec-WebSocket-Key, as defined by RFC 6455 section 1.3.
+func websocketAccept(key string) string {
+	h := sha1.New()
+	io.WriteString(h, key)
+	io.WriteString(h, websocketGUID)
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// firstProtocol returns the first comma-separated subprotocol offered by
+// the client, so STOMP-aware clients that send "v12.stomp, v11.stomp"
+// get an unambiguous echo back.
+func firstProtocol(header string) string {
+	if i := strings.IndexByte(header, ','); i >= 0 {
+		header = header[:i]
+	}
+	return strings.TrimSpace(header)
+}
+
+// websocket frame opcodes, as defined by RFC 6455 section 5.2.
+const (
+	wsOpContinuation = 0x0
+	wsOpText         = 0x1
+	wsOpBinary       = 0x2
+	wsOpClose        = 0x8
+	wsOpPing         = 0x9
+	wsOpPong         = 0xa
+)
+
+// websocketConn adapts a hijacked HTTP connection to the net.Conn
+// interface, transparently decoding inbound WebSocket frames into a flat
+// byte stream on Read and encoding outbound writes as text frames on
+// Write, so the STOMP request processor can treat it like a plain TCP
+// connection.
+type websocketConn struct {
+	net.Conn
+	br         *bufio.Reader
+	maxPayload int64 // rejects a declared frame length beyond this before allocating
+
+	mu      sync.Mutex // serializes writes, matching the one-frame-per-Write contract below
+	readBuf []byte     // unread payload bytes from the current frame
+}
+
+func (c *websocketConn) Read(p []byte) (int, error) {
+	for len(c.readBuf) == 0 {
+		opcode, payload, err := readWebSocketFrame(c.br, c.maxPayload)
+		if err != nil {
+			return 0, err
+		}
+		switch opcode {
+		case wsOpText, wsOpBinary, wsOpContinuation:
+			c.readBuf = payload
+		case wsOpPing:
+			if err := c.writeFrame(wsOpPong, payload); err != nil {
+				return 0, err
+			}
+		case wsOpPong:
+			// Unsolicited pong; nothing to do.
+		case wsOpClose:
+			c.writeFrame(wsOpClose, payload)
+			return 0, io.EOF
+		default:
+			return 0, errors.New("stomp: unsupported websocket opcode")
+		}
+	}
+
+	n := copy(p, c.readBuf)
+	c.readBuf = c.readBuf[n:]
+	return n, nil
+}
+
+func (c *websocketConn) Write(p []byte) (int, error) {
+	if err := c.writeFrame(wsOpText, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (c *websocketConn) writeFrame(opcode byte, payload []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	header := make([]byte, 0, 10)
+	header = append(header, 0x80|opcode) // FIN set, no extensions/fragmentation
+
+	n := len(payload)
+	switch {
+	case n <= 125:
+		header = append(header, byte(n))
+	case n <= 0xffff:
+		header = append(header, 126, byte(n>>8), byte(n))
+	default:
+		header = append(header, 127,
+			byte(n>>56), byte(n>>48), byte(n>>40), byte(n>>32),
+			byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+	// Server-to-client frames are sent unmasked, per RFC 6455 section 5.1.
+
+	if _, err := c.Conn.Write(header); err != nil {
+		return err
+	}
+	_, err := c.Conn.Write(payload)
+	return err
+}
+
+// errWebSocketFrameTooLarge is returned by readWebSocketFrame when a
+// frame's declared payload length exceeds maxPayload.
+var errWebSocketFrameTooLarge = errors.New("stomp: websocket frame exceeds configured size limit")
+
+// readWebSocketFrame reads and unmasks a single WebSocket frame from br.
+// Fragmented messages (continuation frames) are returned to the caller
+// one fragment at a time; the caller reassembles them via Read's loop.
+//
+// The declared length is checked against maxPayload before anything is
+// allocated: it is fully attacker-controlled (up to 2^64-1 via the
+// extended-length field), and allocating on an unchecked claimed length
+// both bypasses Server's configured frame-size limits and, once the
+// claimed length exceeds math.MaxInt, overflows int and panics on
+// make([]byte, n).
+func readWebSocketFrame(br *bufio.Reader, maxPayload int64) (opcode byte, payload []byte, err error) {
+	head, err := readN(br, 2)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	opcode = head[0] & 0x0f
+	masked := head[1]&0x80 != 0
+	length := uint64(head[1] & 0x7f)
+
+	switch length {
+	case 126:
+		ext, err := readN(br, 2)
+		if err != nil {
+			return 0, nil, err
+		}
+		length = uint64(ext[0])<<8 | uint64(ext[1])
+	case 127:
+		ext, err := readN(br, 8)
+		if err != nil {
+			return 0, nil, err
+		}
+		length = 0
+		for _, b := range ext {
+			length = length<<8 | uint64(b)
+		}
+	}
+
+	if maxPayload > 0 && length > uint64(maxPayload) {
+		return 0, nil, errWebSocketFrameTooLarge
+	}
+
+	var maskKey [4]byte
+	if masked {
+		key, err := readN(br, 4)
+		if err != nil {
+			return 0, nil, err
+		}
+		copy(maskKey[:], key)
+	}
+
+	payload, err = readN(br, int(length))
+	if err != nil {
+		return 0, nil, err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= maskKey[i%4]
+		}
+	}
+	return opcode, payload, nil
+}
+
+func readN(br *bufio.Reader, n int) ([]byte, error) {
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(br, buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// upgradeListener is a net.Listener whose connections are supplied from
+// two sources: an embedded net.Listener accepted by an http.Server for
+// performing the WebSocket handshake, and the upgraded connections that
+// handshake produces. This lets Server.Serve consume post-handshake
+// connections through its normal Accept loop while http.Server drives
+// the handshake itself.
+type upgradeListener struct {
+	net.Listener // the raw listener passed to ServeWebSocket
+
+	upgraded chan net.Conn
+	closed   chan struct{}
+	closeMu  sync.Mutex
+	didClose bool
+}
+
+func newUpgradeListener(l net.Listener) *upgradeListener {
+	return &upgradeListener{
+		Listener: l,
+		upgraded: make(chan net.Conn),
+		closed:   make(chan struct{}),
+	}
+}
+
+// httpListener returns the listener that the embedded http.Server should
+// Accept raw (pre-handshake) connections from.
+func (u *upgradeListener) httpListener() net.Listener {
+	return u.Listener
+}
+
+// submit hands an upgraded connection to Accept.
+func (u *upgradeListener) submit(conn net.Conn) {
+	select {
+	case u.upgraded <- conn:
+	case <-u.closed:
+		conn.Close()
+	}
+}
+
+// Accept implements net.Listener by returning connections once they have
+// completed the WebSocket handshake.
+func (u *upgradeListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-u.upgraded:
+		return conn, nil
+	case <-u.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+func (u *upgradeListener) Close() error {
+	u.closeMu.Lock()
+	defer u.closeMu.Unlock()
+	if !u.didClose {
+		u.didClose = true
+		close(u.closed)
+	}
+	return u.Listener.Close()
+}
+
+var _ net.Conn = (*websocketConn)(nil)